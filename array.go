@@ -22,6 +22,12 @@
 //
 package lazy
 
+import (
+	"fmt"
+	"io"
+	"reflect"
+)
+
 // Slicer is the interface that the base array should implement.
 type Slicer interface {
 	Slice(offset, count int) interface{}
@@ -33,6 +39,14 @@ type Slicer interface {
 // allows applications to wait till the limit is zeroed before calling
 // ForEach and collecting all the segments into a simpler form.
 //
+// When Limit is non-zero, Slice and Splice instead operate on a
+// persistent height-balanced tree of segments (balanced by depth, not
+// by the Count of each side): each call splits the
+// tree at the relevant positions and concatenates the pieces back
+// together with AVL-style rotations, all in O(log Count). This keeps
+// ForEach/At/Range cheap to traverse even under a long run of edits at
+// the same offset, without the application ever needing to flatten.
+//
 // Creating a lazy array out of a non-lazy array:
 //
 //     lazyArray := lazy.Array{Limit:100, Count:count, Value:nonLazy}
@@ -47,6 +61,14 @@ type Array struct {
 	// rcount and rep are only set in case of a splice
 	offset, rcount int
 	replacement    *Array
+
+	// depth is the height of this array's concat-node tree: 0 for a
+	// leaf and for any array built by deferredSlice/deferredSplice
+	// (which do not track it), otherwise 1 + max(depth of Value, depth
+	// of *replacement). It
+	// lets split/concat keep that tree within the AVL balance
+	// invariant without ever re-scanning the whole tree.
+	depth int
 }
 
 // Slice simply stores the attempted slice without actually doing
@@ -64,11 +86,26 @@ func (a Array) Slice(offset, count int) Array {
 		return Array{Limit: a.Limit}
 	}
 
+	if a.Limit == 0 {
+		return a.deferredSlice(offset, count)
+	}
+
+	_, tail := a.split(offset)
+	head, _ := tail.split(count)
+	head.Limit = a.Limit
+	return head
+}
+
+// deferredSlice is the original, unbalanced implementation of Slice:
+// it just nests offset/count without ever touching the tree. It is
+// used when Limit is zero, i.e. the caller has opted out of the
+// balanced-tree bookkeeping entirely.
+func (a Array) deferredSlice(offset, count int) Array {
 	if a.replacement == nil {
-		return Array{Limit: a.Limit, Count: count, Value: a.Value, offset: a.offset + offset}
+		return Array{Count: count, Value: a.Value, offset: a.offset + offset}
 	}
 
-	return Array{Limit: a.Limit - 1, Count: count, Value: a, offset: offset}
+	return Array{Count: count, Value: a, offset: offset}
 }
 
 // Splice simply stores the attempted splice. The operation is
@@ -83,15 +120,28 @@ func (a Array) Splice(offset, count int, replacement Array) Array {
 		return replacement
 	}
 
+	if a.Limit == 0 {
+		return a.deferredSplice(offset, count, replacement)
+	}
+
+	left, rest := a.split(offset)
+	_, right := rest.split(count)
+	return concat(concat(left, replacement, a.Limit), right, a.Limit)
+}
+
+// deferredSplice is the original, unbalanced implementation of
+// Splice: it nests the prior array as Value, so a long run of edits
+// at the same offset grows the pending tree's depth linearly. It is
+// used when Limit is zero, i.e. the caller has opted out of the
+// balanced-tree bookkeeping entirely.
+func (a Array) deferredSplice(offset, count int, replacement Array) Array {
 	diff := replacement.Count - count
-	value, limit := a.Value, a.Limit
+	value := a.Value
 	if a.offset != 0 || a.replacement != nil {
 		value = a
-		limit--
 	}
 
 	return Array{
-		Limit:       limit,
 		Count:       a.Count + diff,
 		Value:       value,
 		offset:      offset,
@@ -100,11 +150,254 @@ func (a Array) Splice(offset, count int, replacement Array) Array {
 	}
 }
 
+// Concat appends b to the end of a as a single splice, returning the
+// combined array without flattening either side.
+func (a Array) Concat(b Array) Array {
+	return a.Splice(a.Count, 0, b)
+}
+
+// Concat builds a single lazy array out of many segments using a
+// balanced merge, rather than the O(n) intermediate arrays that
+// repeated Splice(Count, 0, x) calls would produce.
+func Concat(parts ...Array) Array {
+	if len(parts) == 0 {
+		return Array{}
+	}
+	return balance(parts, parts[0].Limit)
+}
+
+// split divides a into two arrays covering [0, pos) and [pos, a.Count)
+// of its logical contents. Every node with depth > 0 was built by
+// newNode/concat, so it is a plain two-child concat node (Value and
+// *replacement are its left and right subtrees); split just descends
+// into whichever child straddles pos and re-concats the other child
+// back on, so the cost is O(depth) rather than O(Count). A depth-0
+// node is split as a leaf; a deferred splice made with Limit zero is
+// such a leaf and is sliced as a whole.
+func (a Array) split(pos int) (Array, Array) {
+	if pos == 0 {
+		return Array{Limit: a.Limit}, a
+	}
+	if pos == a.Count {
+		return a, Array{Limit: a.Limit}
+	}
+
+	if a.depth == 0 {
+		if a.replacement != nil {
+			return Array{Limit: a.Limit, Count: pos, Value: a},
+				Array{Limit: a.Limit, Count: a.Count - pos, Value: a, offset: pos}
+		}
+		return Array{Limit: a.Limit, Count: pos, Value: a.Value, offset: a.offset},
+			Array{Limit: a.Limit, Count: a.Count - pos, Value: a.Value, offset: a.offset + pos}
+	}
+
+	left, right := a.children()
+	if pos <= left.Count {
+		vLeft, vRight := left.split(pos)
+		return vLeft, newNode(vRight, right, a.Limit)
+	}
+	vLeft, vRight := right.split(pos - left.Count)
+	return newNode(left, vLeft, a.Limit), vRight
+}
+
+// newNode builds a plain two-child concat node: a followed by b, with
+// no splice/replacement semantics of its own.
+func newNode(a, b Array, limit int) Array {
+	depth := a.depth
+	if b.depth > depth {
+		depth = b.depth
+	}
+
+	return Array{
+		Limit:       limit,
+		Count:       a.Count + b.Count,
+		Value:       a,
+		offset:      a.Count,
+		replacement: &b,
+		depth:       depth + 1,
+	}
+}
+
+// children returns the two subtrees of a concat node built by
+// newNode/concat. It is only valid on such nodes (depth > 0 implies
+// Value is an Array and replacement is set).
+func (a Array) children() (Array, Array) {
+	return a.Value.(Array), *a.replacement
+}
+
+func rotateLeft(a Array, limit int) Array {
+	left, right := a.children()
+	rl, rr := right.children()
+	return newNode(newNode(left, rl, limit), rr, limit)
+}
+
+func rotateRight(a Array, limit int) Array {
+	left, right := a.children()
+	ll, lr := left.children()
+	return newNode(ll, newNode(lr, right, limit), limit)
+}
+
+// rebalance restores the AVL invariant at a's root with a single or
+// double rotation, assuming both children already satisfy it.
+func rebalance(a Array, limit int) Array {
+	left, right := a.children()
+
+	if left.depth > right.depth+1 {
+		ll, lr := left.children()
+		if lr.depth > ll.depth {
+			left = rotateLeft(left, limit)
+		}
+		return rotateRight(newNode(left, right, limit), limit)
+	}
+
+	if right.depth > left.depth+1 {
+		rl, rr := right.children()
+		if rl.depth > rr.depth {
+			right = rotateRight(right, limit)
+		}
+		return rotateLeft(newNode(left, right, limit), limit)
+	}
+
+	return a
+}
+
+// concat joins a followed by b into a single array, descending the
+// taller side and rebalancing on the way back up — the standard
+// AVL-tree join — so the result stays O(log Count) deep in O(log
+// Count) time rather than a full rebuild.
+func concat(a, b Array, limit int) Array {
+	if a.Count == 0 {
+		b.Limit = limit
+		return b
+	}
+	if b.Count == 0 {
+		a.Limit = limit
+		return a
+	}
+
+	if a.depth > b.depth+1 {
+		al, ar := a.children()
+		return rebalance(newNode(al, concat(ar, b, limit), limit), limit)
+	}
+	if b.depth > a.depth+1 {
+		bl, br := b.children()
+		return rebalance(newNode(concat(a, bl, limit), br, limit), limit)
+	}
+	return newNode(a, b, limit)
+}
+
+// balance merges segments pairwise, bottom-up, into a single array
+// whose pending tree has depth O(log len(segments)).
+func balance(segments []Array, limit int) Array {
+	if len(segments) == 0 {
+		return Array{Limit: limit}
+	}
+
+	for len(segments) > 1 {
+		next := make([]Array, 0, (len(segments)+1)/2)
+		for i := 0; i < len(segments); i += 2 {
+			if i+1 == len(segments) {
+				next = append(next, segments[i])
+				continue
+			}
+			next = append(next, newNode(segments[i], segments[i+1], limit))
+		}
+		segments = next
+	}
+
+	result := segments[0]
+	result.Limit = limit
+	return result
+}
+
 // ForEach visits all the underlying segments.
 func (a Array) ForEach(fn func(v interface{}, count int)) {
 	a.forEach(0, a.Count, fn)
 }
 
+// At returns the one-element slice (Slice(offset, 1) of the underlying
+// segment) at index, descending the deferred splice/slice tree to only the branch that
+// overlaps index rather than scanning every segment.
+func (a Array) At(index int) interface{} {
+	if index < 0 || index >= a.Count {
+		panic("invalid index")
+	}
+
+	var result interface{}
+	a.forEach(index, 1, func(v interface{}, count int) {
+		result = v
+	})
+	return result
+}
+
+// Range visits the segments of the underlying array that overlap
+// [start, end), using the same intersect/descent logic as ForEach but
+// pruning branches outside the requested range.
+func (a Array) Range(start, end int, fn func(v interface{}, count int)) {
+	if start < 0 || end < start || end > a.Count {
+		panic("invalid range args")
+	}
+
+	a.forEach(start, end-start, fn)
+}
+
+// WriteTo streams the logical contents of a directly to w, visiting
+// segments with ForEach rather than first materializing a flattened
+// copy. Each segment's underlying value must be byte-like, i.e. a
+// string or []byte (or a named type with one of those as its
+// underlying type) — the natural leaf type for a lazy rope over a
+// large text buffer.
+func (a Array) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	var err error
+	a.ForEach(func(v interface{}, count int) {
+		if err != nil {
+			return
+		}
+
+		b, ok := segmentBytes(v)
+		if !ok {
+			err = fmt.Errorf("lazy: WriteTo: unsupported segment type %T", v)
+			return
+		}
+
+		var n int
+		n, err = w.Write(b)
+		written += int64(n)
+	})
+	return written, err
+}
+
+// NewReader returns an io.Reader streaming the logical contents of a
+// in the same order as WriteTo, the read-side counterpart to it, for
+// arrays whose segments are byte-like. It streams through an io.Pipe
+// rather than materializing a flattened copy up front. The returned
+// io.Reader offers no Close, so the goroutine driving the write side
+// exits only once the reader has been read to the end.
+func (a Array) NewReader() io.Reader {
+	r, w := io.Pipe()
+	go func() {
+		_, err := a.WriteTo(w)
+		w.CloseWithError(err)
+	}()
+	return r
+}
+
+// segmentBytes extracts the raw bytes of a byte-like segment value,
+// i.e. one whose underlying type is string or []byte.
+func segmentBytes(v interface{}) ([]byte, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String:
+		return []byte(rv.String()), true
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return rv.Bytes(), true
+		}
+	}
+	return nil, false
+}
+
 func forEach(v interface{}, offset, count int, fn func(interface{}, int)) {
 	if count == 0 {
 		return
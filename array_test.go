@@ -5,8 +5,11 @@
 package lazy_test
 
 import (
+	"encoding/gob"
+	"encoding/json"
 	"flag"
 	"github.com/perdata/lazy"
+	"io/ioutil"
 	"math/rand"
 	"strings"
 	"testing"
@@ -106,6 +109,167 @@ func TestInvalidOffsets(t *testing.T) {
 	})
 }
 
+func TestAtAndRange(t *testing.T) {
+	jimbo := newArray("j").Splice(1, 0, newArray("imbo"))
+
+	for i, want := range "jimbo" {
+		if got := jimbo.At(i); got != Slicer(string(want)) {
+			t.Fatal("At", i, got, want)
+		}
+	}
+
+	mustPanic := func(fn func()) {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Fatal("Failed to panic")
+			}
+		}()
+		fn()
+	}
+
+	mustPanic(func() { jimbo.At(-1) })
+	mustPanic(func() { jimbo.At(jimbo.Count) })
+
+	result := ""
+	jimbo.Range(1, 4, func(v interface{}, count int) {
+		result += string(v.(Slicer))
+	})
+	if result != "imb" {
+		t.Fatal("Range", result)
+	}
+
+	mustPanic(func() { jimbo.Range(-1, 2, func(interface{}, int) {}) })
+	mustPanic(func() { jimbo.Range(2, 1, func(interface{}, int) {}) })
+	mustPanic(func() { jimbo.Range(0, jimbo.Count+1, func(interface{}, int) {}) })
+}
+
+func TestConcat(t *testing.T) {
+	hello := newArray("hello")
+	world := newArray("world")
+
+	if x := toString(hello.Concat(world)); x != "helloworld" {
+		t.Fatal("Concat", x)
+	}
+
+	if x := toString(lazy.Concat(newArray("a"), newArray("b"), newArray("c"))); x != "abc" {
+		t.Fatal("package Concat", x)
+	}
+
+	if x := toString(lazy.Concat()); x != "" {
+		t.Fatal("empty package Concat", x)
+	}
+}
+
+func TestWriteTo(t *testing.T) {
+	jimbo := newArray("j").Splice(1, 0, newArray("imbo"))
+
+	var buf strings.Builder
+	n, err := jimbo.WriteTo(&buf)
+	if err != nil {
+		t.Fatal("WriteTo error", err)
+	}
+	if n != int64(jimbo.Count) || buf.String() != "jimbo" {
+		t.Fatal("WriteTo", n, buf.String())
+	}
+}
+
+func TestNewReader(t *testing.T) {
+	jimbo := newArray("j").Splice(1, 0, newArray("imbo"))
+
+	data, err := ioutil.ReadAll(jimbo.NewReader())
+	if err != nil {
+		t.Fatal("NewReader read error", err)
+	}
+	if string(data) != "jimbo" {
+		t.Fatal("NewReader", string(data))
+	}
+}
+
+func TestBinaryMarshaling(t *testing.T) {
+	jimbo := newArray("j").Splice(1, 0, newArray("imbo"))
+
+	data, err := jimbo.MarshalBinary()
+	if err != nil {
+		t.Fatal("MarshalBinary", err)
+	}
+
+	var decoded lazy.Array
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatal("UnmarshalBinary", err)
+	}
+
+	var buf strings.Builder
+	if _, err := decoded.WriteTo(&buf); err != nil {
+		t.Fatal("WriteTo after decode", err)
+	}
+	if buf.String() != "jimbo" {
+		t.Fatal("round trip mismatch", buf.String())
+	}
+}
+
+func TestJSONMarshaling(t *testing.T) {
+	hello := newArray("hello")
+
+	data, err := json.Marshal(hello)
+	if err != nil {
+		t.Fatal("json.Marshal", err)
+	}
+
+	var decoded lazy.Array
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal("json.Unmarshal", err)
+	}
+
+	var buf strings.Builder
+	decoded.WriteTo(&buf)
+	if buf.String() != "hello" {
+		t.Fatal("json round trip mismatch", buf.String())
+	}
+}
+
+func TestGobMarshaling(t *testing.T) {
+	hello := newArray("hello")
+
+	var buf strings.Builder
+	if err := gob.NewEncoder(&buf).Encode(hello); err != nil {
+		t.Fatal("gob.Encode", err)
+	}
+
+	var decoded lazy.Array
+	if err := gob.NewDecoder(strings.NewReader(buf.String())).Decode(&decoded); err != nil {
+		t.Fatal("gob.Decode", err)
+	}
+
+	var out strings.Builder
+	decoded.WriteTo(&out)
+	if out.String() != "hello" {
+		t.Fatal("gob round trip mismatch", out.String())
+	}
+}
+
+func TestRebalanceOnRepeatedSplices(t *testing.T) {
+	// Splicing at the same offset repeatedly is the worst case for the
+	// unbalanced chain described in the rebalance design: it used to
+	// make the pending tree's depth grow linearly with the number of
+	// edits. With Limit set, Splice keeps the tree balanced on every
+	// edit instead; depth is not visible from this package, so the test
+	// checks that the contents still match a plain string splice.
+	s := "hello"
+	a := lazy.Array{Limit: 1000, Count: len(s), Value: Slicer(s)}
+
+	for i := 0; i < 5000; i++ {
+		s = "x" + s[1:]
+		a = a.Splice(0, 1, lazy.Array{Limit: 1000, Count: 1, Value: Slicer("x")})
+	}
+
+	if x := toString(a); x != s {
+		t.Fatal("rebalance diverged from reference string", x, s)
+	}
+	if x := toString(a.Slice(1, 2)); x != s[1:3] {
+		t.Fatal("rebalance slice diverged", x, s[1:3])
+	}
+}
+
 func TestRandomSplices(t *testing.T) {
 	initRandomString(10)
 	defer initRandomString(strlen)
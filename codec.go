@@ -0,0 +1,233 @@
+// Copyright (C) 2018 Ramesh Vyaghrapuri. All rights reserved.
+// Use of this source code is governed by a MIT-style license
+// that can be found in the LICENSE file.
+
+package lazy
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+)
+
+// slicerRegistry maps the registered name of a custom, non-byte-like
+// Slicer type to a factory that reconstructs it from its encoded
+// bytes. Byte-like segments (string or []byte) are handled directly
+// and never need to be registered.
+var (
+	slicerRegistryMu sync.RWMutex
+	slicerRegistry   = map[string]func([]byte) Slicer{}
+)
+
+// RegisterSlicer registers a factory for reconstructing a custom
+// Slicer type from its encoded bytes when decoding an Array produced
+// by MarshalBinary/GobEncode, analogous to how encoding/gob registers
+// concrete types for interface values. name must match
+// fmt.Sprintf("%T", v) for values v of that type, since that is the
+// tag MarshalBinary records for them.
+func RegisterSlicer(name string, factory func([]byte) Slicer) {
+	slicerRegistryMu.Lock()
+	defer slicerRegistryMu.Unlock()
+	slicerRegistry[name] = factory
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler. It walks a with
+// ForEach and writes a length-prefixed stream of (tag, count, bytes)
+// segments, so a deferred splice/slice tree can be persisted or sent
+// across the wire without flattening it into a single value first.
+// Byte-like segments (string or []byte) are encoded directly; any
+// other segment type must implement encoding.BinaryMarshaler and have
+// a factory registered with RegisterSlicer under its own type name.
+func (a Array) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+
+	a.ForEach(func(v interface{}, count int) {
+		if err != nil {
+			return
+		}
+
+		var tag string
+		var data []byte
+		if b, ok := segmentBytes(v); ok {
+			tag, data = segmentTag(v), b
+		} else if m, ok := v.(encoding.BinaryMarshaler); ok {
+			tag = fmt.Sprintf("%T", v)
+			if data, err = m.MarshalBinary(); err != nil {
+				return
+			}
+		} else {
+			err = fmt.Errorf("lazy: MarshalBinary: type %T is not byte-like and does not implement encoding.BinaryMarshaler", v)
+			return
+		}
+
+		writeSegment(&buf, tag, count, data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// segmentTag returns the built-in tag for a byte-like segment value.
+func segmentTag(v interface{}) string {
+	if reflect.ValueOf(v).Kind() == reflect.String {
+		return "string"
+	}
+	return "bytes"
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. It rebuilds
+// a flat Array as a tree of concat nodes over the segments read from
+// data, merged pairwise so its depth is O(log) of the segment count
+// (segment lengths are not weighed), matching the stream written by
+// MarshalBinary.
+func (a *Array) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+
+	var segments []Array
+	for r.Len() > 0 {
+		tag, err := readString(r)
+		if err != nil {
+			return err
+		}
+		count, err := readInt(r)
+		if err != nil {
+			return err
+		}
+		if count < 0 {
+			return fmt.Errorf("lazy: UnmarshalBinary: invalid segment count %d", count)
+		}
+		raw, err := readBytes(r)
+		if err != nil {
+			return err
+		}
+
+		v, err := decodeSegment(tag, raw)
+		if err != nil {
+			return err
+		}
+		segments = append(segments, Array{Count: count, Value: v})
+	}
+
+	*a = balance(segments, 0)
+	return nil
+}
+
+// decodeSegment reconstructs the Slicer value for one encoded
+// segment, using the built-in string/bytes tags or a factory
+// registered with RegisterSlicer.
+func decodeSegment(tag string, data []byte) (Slicer, error) {
+	switch tag {
+	case "string":
+		return stringSlicer(data), nil
+	case "bytes":
+		return bytesSlicer(data), nil
+	}
+
+	slicerRegistryMu.RLock()
+	factory, ok := slicerRegistry[tag]
+	slicerRegistryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("lazy: UnmarshalBinary: no Slicer registered for type %q; call RegisterSlicer first", tag)
+	}
+	return factory(data), nil
+}
+
+// stringSlicer and bytesSlicer let Array encode and decode plain
+// string/[]byte leaves without requiring the caller to register a
+// Slicer implementation for them.
+type stringSlicer string
+
+func (s stringSlicer) Slice(offset, count int) interface{} {
+	return stringSlicer(s[offset : offset+count])
+}
+
+type bytesSlicer []byte
+
+func (b bytesSlicer) Slice(offset, count int) interface{} {
+	return bytesSlicer(b[offset : offset+count])
+}
+
+// GobEncode implements gob.GobEncoder in terms of MarshalBinary.
+func (a Array) GobEncode() ([]byte, error) {
+	return a.MarshalBinary()
+}
+
+// GobDecode implements gob.GobDecoder in terms of UnmarshalBinary.
+func (a *Array) GobDecode(data []byte) error {
+	return a.UnmarshalBinary(data)
+}
+
+// MarshalJSON implements json.Marshaler by base64-encoding the same
+// segment stream produced by MarshalBinary.
+func (a Array) MarshalJSON() ([]byte, error) {
+	data, err := a.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(data)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, decoding the segment
+// stream written by MarshalJSON.
+func (a *Array) UnmarshalJSON(data []byte) error {
+	var b []byte
+	if err := json.Unmarshal(data, &b); err != nil {
+		return err
+	}
+	return a.UnmarshalBinary(b)
+}
+
+func writeSegment(buf *bytes.Buffer, tag string, count int, data []byte) {
+	writeBytes(buf, []byte(tag))
+	writeInt(buf, count)
+	writeBytes(buf, data)
+}
+
+func writeBytes(buf *bytes.Buffer, b []byte) {
+	var lenBuf [4]byte
+	binary.BigEndian.PutUint32(lenBuf[:], uint32(len(b)))
+	buf.Write(lenBuf[:])
+	buf.Write(b)
+}
+
+func writeInt(buf *bytes.Buffer, n int) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(n))
+	buf.Write(b[:])
+}
+
+func readBytes(r *bytes.Reader) ([]byte, error) {
+	var lenBuf [4]byte
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(lenBuf[:])
+	if int64(n) > int64(r.Len()) {
+		return nil, fmt.Errorf("lazy: decode: segment length %d exceeds remaining input", n)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func readString(r *bytes.Reader) (string, error) {
+	b, err := readBytes(r)
+	return string(b), err
+}
+
+func readInt(r *bytes.Reader) (int, error) {
+	var b [8]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return 0, err
+	}
+	return int(binary.BigEndian.Uint64(b[:])), nil
+}